@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// addon is a unit of cluster functionality that can be layered on top of a
+// freshly installed cluster by "kismatic apply". Addons are registered with
+// an addonRegistry and applied in dependency order, replacing the ad-hoc
+// if-blocks that used to live in applyCmd.run.
+type addon interface {
+	// Name is used in log output and as a dependency key for other addons.
+	Name() string
+	// Enabled reports whether the plan file asks for this addon.
+	Enabled(plan *install.Plan) bool
+	// Dependencies lists the Name() of addons that must be applied first.
+	Dependencies() []string
+	// Apply installs or reconciles the addon against the cluster described
+	// by plan, using c for its executor, output and generated-assets dir.
+	Apply(c *applyCmd, plan *install.Plan) error
+}
+
+// addonRegistry holds the set of addons known to "kismatic apply" and
+// resolves the order they must be applied in.
+type addonRegistry struct {
+	addons []addon
+}
+
+// newAddonRegistry returns the registry of addons known to this version of
+// kismatic.
+func newAddonRegistry() *addonRegistry {
+	return &addonRegistry{
+		addons: []addon{
+			helmAddon{},
+			chartsAddon{},
+			heapsterAddon{},
+			metricsServerAddon{},
+			dashboardAddon{},
+			storageClassAddon{},
+			storageProvisionerAddon{},
+			clusterAutoscalerAddon{},
+			cniAddon{},
+		},
+	}
+}
+
+// Enabled returns the addons the plan file requests, topologically sorted so
+// that an addon's dependencies are applied before it.
+func (r *addonRegistry) Enabled(plan *install.Plan) ([]addon, error) {
+	wanted := map[string]addon{}
+	for _, a := range r.addons {
+		if a.Enabled(plan) {
+			wanted[a.Name()] = a
+		}
+	}
+
+	var ordered []addon
+	visited := map[string]bool{}
+	visiting := map[string]bool{}
+
+	var visit func(a addon) error
+	visit = func(a addon) error {
+		if visited[a.Name()] {
+			return nil
+		}
+		if visiting[a.Name()] {
+			return fmt.Errorf("circular addon dependency detected at %q", a.Name())
+		}
+		visiting[a.Name()] = true
+		for _, dep := range a.Dependencies() {
+			depAddon, ok := wanted[dep]
+			if !ok {
+				return fmt.Errorf("%s requires %s to be enabled", a.Name(), dep)
+			}
+			if err := visit(depAddon); err != nil {
+				return err
+			}
+		}
+		visiting[a.Name()] = false
+		visited[a.Name()] = true
+		ordered = append(ordered, a)
+		return nil
+	}
+
+	// Walk the registry (not the map) so ordering is deterministic when there
+	// are no dependency constraints between two addons.
+	for _, a := range r.addons {
+		if _, ok := wanted[a.Name()]; !ok {
+			continue
+		}
+		if err := visit(a); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// helmAddon bootstraps the Helm client, transparently picking between the
+// Tiller-based v2 flow and the tillerless v3 flow based on the plan file.
+type helmAddon struct{}
+
+func (helmAddon) Name() string                    { return "Helm" }
+func (helmAddon) Dependencies() []string          { return nil }
+func (helmAddon) Enabled(plan *install.Plan) bool { return plan.Features.PackageManager.Enabled }
+func (a helmAddon) Apply(c *applyCmd, plan *install.Plan) error {
+	stage := "addon:" + a.Name()
+	if plan.Features.PackageManager.Version == "v3" {
+		// Helm v3 is tillerless: no RBAC service account or "helm init"
+		// required, just the client binary and its config/data dirs.
+		return c.executor.RunPlay(stage, "_helm3.yaml", plan)
+	}
+	if !c.dryRun {
+		// Dry-run must never touch the control machine's real ~/.helm
+		// directory; it only renders what a real apply would have run.
+		home, err := homedir.Dir()
+		if err != nil {
+			return fmt.Errorf("could not determine helm directory: %v", err)
+		}
+		helmDir := path.Join(home, ".helm")
+		backupDir := fmt.Sprintf("%s.backup-%s", helmDir, time.Now().Format("2006-01-02-15-04-05"))
+		// Backup helm directory if exists
+		if backedup, err := util.BackupDirectory(helmDir, backupDir); err != nil {
+			return fmt.Errorf("error preparing Helm client: %v", err)
+		} else if backedup {
+			util.PrettyPrintOk(c.out, "Backed up %q directory", helmDir)
+		}
+	}
+	// Create a new serviceaccount and run helm init
+	return c.executor.RunPlay(stage, "_helm.yaml", plan)
+}
+
+// chartsAddon installs the chart releases declared under plan.Features.Charts,
+// reconciling against what was recorded on the previous apply: a release
+// whose version changed is upgraded, a release removed from the plan file is
+// uninstalled.
+type chartsAddon struct{}
+
+func (chartsAddon) Name() string                    { return "Charts" }
+func (chartsAddon) Dependencies() []string          { return []string{"Helm"} }
+func (chartsAddon) Enabled(plan *install.Plan) bool { return len(plan.Features.Charts) > 0 }
+func (a chartsAddon) Apply(c *applyCmd, plan *install.Plan) error {
+	stage := "addon:" + a.Name()
+	current := plan.Features.Charts
+	prev, err := install.ReadChartReleases(c.generatedAssetsDir)
+	if err != nil {
+		return fmt.Errorf("error reading previously installed chart releases: %v", err)
+	}
+
+	for _, removed := range install.RemovedChartReleases(prev, current) {
+		util.PrettyPrintOk(c.out, "Uninstalling release %q, removed from the plan file", removed.ReleaseName)
+		if err := c.executor.UninstallRelease(removed.ReleaseName, removed.Namespace); err != nil {
+			return fmt.Errorf("error uninstalling release %q: %v", removed.ReleaseName, err)
+		}
+	}
+
+	changed := install.ChangedChartReleases(prev, current)
+	if len(changed) > 0 {
+		if err := c.executor.RunPlay(stage, "_charts.yaml", plan); err != nil {
+			return err
+		}
+		for _, chart := range changed {
+			if _, existed := install.FindChartRelease(prev, chart.ReleaseName); existed {
+				util.PrettyPrintOk(c.out, "Upgraded release %q to chart version %q", chart.ReleaseName, chart.Version)
+			} else {
+				util.PrettyPrintOk(c.out, "Installed release %q from chart %q", chart.ReleaseName, chart.ChartName)
+			}
+		}
+	}
+
+	if c.dryRun {
+		// Never overwrite the real chart-releases.json with state computed
+		// from a simulated run; only a real apply may record it.
+		return nil
+	}
+
+	// Record the releases we manage so the next apply can reconcile
+	// against them.
+	return install.WriteChartReleases(current, c.generatedAssetsDir)
+}
+
+// heapsterAddon installs the (now legacy) Heapster monitoring pipeline.
+type heapsterAddon struct{}
+
+func (heapsterAddon) Name() string           { return "Heapster" }
+func (heapsterAddon) Dependencies() []string { return nil }
+func (heapsterAddon) Enabled(plan *install.Plan) bool {
+	return plan.Features.HeapsterMonitoring.Enabled
+}
+func (a heapsterAddon) Apply(c *applyCmd, plan *install.Plan) error {
+	return c.executor.RunPlay("addon:"+a.Name(), "_heapster.yaml", plan)
+}
+
+// metricsServerAddon installs metrics-server, Heapster's successor, used by
+// "kubectl top" and the horizontal pod autoscaler.
+type metricsServerAddon struct{}
+
+func (metricsServerAddon) Name() string           { return "Metrics Server" }
+func (metricsServerAddon) Dependencies() []string { return nil }
+func (metricsServerAddon) Enabled(plan *install.Plan) bool {
+	return plan.Features.MetricsServer.Enabled
+}
+func (a metricsServerAddon) Apply(c *applyCmd, plan *install.Plan) error {
+	return c.executor.RunPlay("addon:"+a.Name(), "_metrics_server.yaml", plan)
+}
+
+// dashboardAddon installs the Kubernetes Dashboard.
+type dashboardAddon struct{}
+
+func (dashboardAddon) Name() string                    { return "Kubernetes Dashboard" }
+func (dashboardAddon) Dependencies() []string          { return nil }
+func (dashboardAddon) Enabled(plan *install.Plan) bool { return plan.Features.Dashboard.Enabled }
+func (a dashboardAddon) Apply(c *applyCmd, plan *install.Plan) error {
+	return c.executor.RunPlay("addon:"+a.Name(), "_dashboard.yaml", plan)
+}
+
+// storageClassAddon marks a StorageClass as the cluster default.
+type storageClassAddon struct{}
+
+func (storageClassAddon) Name() string           { return "Default Storage Class" }
+func (storageClassAddon) Dependencies() []string { return []string{"Storage Provisioner"} }
+func (storageClassAddon) Enabled(plan *install.Plan) bool {
+	return plan.Features.DefaultStorageClass.Enabled
+}
+func (a storageClassAddon) Apply(c *applyCmd, plan *install.Plan) error {
+	return c.executor.RunPlay("addon:"+a.Name(), "_storage_class.yaml", plan)
+}
+
+// storageProvisionerAddon installs the dynamic storage provisioner that backs
+// the default StorageClass.
+type storageProvisionerAddon struct{}
+
+func (storageProvisionerAddon) Name() string           { return "Storage Provisioner" }
+func (storageProvisionerAddon) Dependencies() []string { return nil }
+func (storageProvisionerAddon) Enabled(plan *install.Plan) bool {
+	return plan.Features.StorageProvisioner.Enabled
+}
+func (a storageProvisionerAddon) Apply(c *applyCmd, plan *install.Plan) error {
+	return c.executor.RunPlay("addon:"+a.Name(), "_storage_provisioner.yaml", plan)
+}
+
+// clusterAutoscalerAddon installs cluster-autoscaler for the plan's cloud
+// provider.
+type clusterAutoscalerAddon struct{}
+
+func (clusterAutoscalerAddon) Name() string           { return "Cluster Autoscaler" }
+func (clusterAutoscalerAddon) Dependencies() []string { return nil }
+func (clusterAutoscalerAddon) Enabled(plan *install.Plan) bool {
+	return plan.Features.ClusterAutoscaler.Enabled
+}
+func (a clusterAutoscalerAddon) Apply(c *applyCmd, plan *install.Plan) error {
+	return c.executor.RunPlay("addon:"+a.Name(), "_cluster_autoscaler.yaml", plan)
+}
+
+// cniAddon installs the CNI plugin chosen in the plan file.
+type cniAddon struct{}
+
+func (cniAddon) Name() string                    { return "CNI" }
+func (cniAddon) Dependencies() []string          { return nil }
+func (cniAddon) Enabled(plan *install.Plan) bool { return plan.Features.CNI.Provider != "" }
+func (a cniAddon) Apply(c *applyCmd, plan *install.Plan) error {
+	return c.executor.RunPlay("addon:"+a.Name(), fmt.Sprintf("_cni_%s.yaml", plan.Features.CNI.Provider), plan)
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+func TestAddonRegistryEnabledOrdersDependenciesFirst(t *testing.T) {
+	plan := &install.Plan{
+		Features: install.PlanFeatures{
+			PackageManager: install.PackageManagerOptions{Enabled: true},
+			Charts:         []install.ChartRelease{{ReleaseName: "nginx"}},
+			AddonFeatures:  install.AddonFeatures{StorageProvisioner: install.EnabledOptions{Enabled: true}},
+		},
+	}
+	addons, err := newAddonRegistry().Enabled(plan)
+	if err != nil {
+		t.Fatalf("Enabled returned error: %v", err)
+	}
+
+	pos := map[string]int{}
+	for i, a := range addons {
+		pos[a.Name()] = i
+	}
+	if _, ok := pos["Helm"]; !ok {
+		t.Fatalf("expected Helm addon to be enabled, got %v", names(addons))
+	}
+	if _, ok := pos["Charts"]; !ok {
+		t.Fatalf("expected Charts addon to be enabled, got %v", names(addons))
+	}
+	if pos["Helm"] >= pos["Charts"] {
+		t.Errorf("expected Helm to be ordered before Charts, got order %v", names(addons))
+	}
+}
+
+func TestAddonRegistryEnabledFailsOnMissingDependency(t *testing.T) {
+	plan := &install.Plan{
+		Features: install.PlanFeatures{
+			AddonFeatures: install.AddonFeatures{DefaultStorageClass: install.EnabledOptions{Enabled: true}},
+		},
+	}
+	_, err := newAddonRegistry().Enabled(plan)
+	if err == nil {
+		t.Fatal("expected an error when Default Storage Class is enabled without Storage Provisioner")
+	}
+	want := "Default Storage Class requires Storage Provisioner to be enabled"
+	if err.Error() != want {
+		t.Errorf("got error %q, want %q", err.Error(), want)
+	}
+}
+
+func TestAddonRegistryEnabledNoAddonsRequested(t *testing.T) {
+	addons, err := newAddonRegistry().Enabled(&install.Plan{})
+	if err != nil {
+		t.Fatalf("Enabled returned error: %v", err)
+	}
+	if len(addons) != 0 {
+		t.Errorf("expected no addons to be enabled, got %v", names(addons))
+	}
+}
+
+func names(addons []addon) []string {
+	n := make([]string, len(addons))
+	for i, a := range addons {
+		n[i] = a.Name()
+	}
+	return n
+}
@@ -9,7 +9,6 @@ import (
 
 	"github.com/apprenda/kismatic/pkg/install"
 	"github.com/apprenda/kismatic/pkg/util"
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 )
 
@@ -22,6 +21,9 @@ type applyCmd struct {
 	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	dryRun             bool
+	resume             bool
+	restartFrom        string
 }
 
 type applyOpts struct {
@@ -30,6 +32,10 @@ type applyOpts struct {
 	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	dryRun             bool
+	renderOnly         bool
+	resume             bool
+	restartFrom        string
 }
 
 // NewCmdApply creates a cluter using the plan file
@@ -42,12 +48,24 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 			if len(args) != 0 {
 				return fmt.Errorf("Unexpected args: %v", args)
 			}
+			// --render-only implies --dry-run (it's a stricter variant that
+			// also skips pre-flight node connectivity checks, so it can run
+			// from the plan file alone with no reachable cluster).
+			dryRun := applyOpts.dryRun || applyOpts.renderOnly
+			skipPreFlight := applyOpts.skipPreFlight || applyOpts.renderOnly
+
 			planner := &install.FilePlanner{File: installOpts.planFilename}
 			executorOpts := install.ExecutorOptions{
 				GeneratedAssetsDirectory: applyOpts.generatedAssetsDir,
 				RestartServices:          applyOpts.restartServices,
 				OutputFormat:             applyOpts.outputFormat,
 				Verbose:                  applyOpts.verbose,
+				DryRun:                   dryRun,
+			}
+			if applyOpts.outputFormat == "json" {
+				executorOpts.OnEvent = func(stage, host, task, status string, err error) {
+					emitJSONEvent(out, stage, host, task, status, err)
+				}
 			}
 			executor, err := install.NewExecutor(out, os.Stderr, executorOpts)
 			if err != nil {
@@ -62,7 +80,10 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 				generatedAssetsDir: applyOpts.generatedAssetsDir,
 				verbose:            applyOpts.verbose,
 				outputFormat:       applyOpts.outputFormat,
-				skipPreFlight:      applyOpts.skipPreFlight,
+				skipPreFlight:      skipPreFlight,
+				dryRun:             dryRun,
+				resume:             applyOpts.resume,
+				restartFrom:        applyOpts.restartFrom,
 			}
 			return applyCmd.run()
 		},
@@ -72,13 +93,29 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 	cmd.Flags().StringVar(&applyOpts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().BoolVar(&applyOpts.restartServices, "restart-services", false, "force restart cluster services (Use with care)")
 	cmd.Flags().BoolVar(&applyOpts.verbose, "verbose", false, "enable verbose logging from the installation")
-	cmd.Flags().StringVarP(&applyOpts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().StringVarP(&applyOpts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\"|\"json\")")
 	cmd.Flags().BoolVar(&applyOpts.skipPreFlight, "skip-preflight", false, "skip pre-flight checks, useful when rerunning kismatic")
+	cmd.Flags().BoolVar(&applyOpts.dryRun, "dry-run", false, "render the inventory, kubeconfig and playbook variables under \"generated-assets-dir/dry-run/\" without making any changes to the nodes")
+	cmd.Flags().BoolVar(&applyOpts.renderOnly, "render-only", false, "like --dry-run, but also skips pre-flight node connectivity checks, so it can run from the plan file alone with no reachable cluster")
+	cmd.Flags().BoolVar(&applyOpts.resume, "resume", false, "resume a previous apply, skipping stages already recorded as complete in \"generated-assets-dir/apply-state.json\"")
+	cmd.Flags().StringVar(&applyOpts.restartFrom, "restart-from", "", "force the named stage (and every stage after it) to re-run, even if --resume would otherwise skip it")
 
 	return cmd
 }
 
 func (c *applyCmd) run() error {
+	jsonOutput := c.outputFormat == "json"
+
+	// jsonFail reports a setup error (one that happens before runStage can
+	// emit it) as a single JSON event, so --output json reports even failures
+	// this early on the event stream. The error is still returned to the
+	// caller as well.
+	jsonFail := func(stage string, err error) {
+		if jsonOutput {
+			emitJSONEvent(c.out, stage, "", "", "error", err)
+		}
+	}
+
 	// Validate and run pre-flight
 	opts := &validateOpts{
 		planFile:           c.planFile,
@@ -89,66 +126,166 @@ func (c *applyCmd) run() error {
 	}
 	err := doValidate(c.out, c.planner, opts)
 	if err != nil {
-		return fmt.Errorf("error validating plan: %v", err)
+		err = fmt.Errorf("error validating plan: %v", err)
+		jsonFail("setup", err)
+		return err
 	}
 	plan, err := c.planner.Read()
 	if err != nil {
-		return fmt.Errorf("error reading plan file: %v", err)
+		err = fmt.Errorf("error reading plan file: %v", err)
+		jsonFail("setup", err)
+		return err
+	}
+
+	if c.dryRun && !jsonOutput {
+		util.PrintColor(c.out, util.Blue, "Running in dry-run mode: no changes will be made to the nodes.\n")
+		util.PrintColor(c.out, util.Blue, "Rendered assets will be written to %q\n", path.Join(c.generatedAssetsDir, "dry-run"))
+	}
+
+	// Apply addons in dependency order
+	addons, err := newAddonRegistry().Enabled(plan)
+	if err != nil {
+		jsonFail("setup", err)
+		return fmt.Errorf("error resolving addons: %v", err)
+	}
+	stageOrder := []string{"certificates", "kubeconfig", "install"}
+	for _, addon := range addons {
+		stageOrder = append(stageOrder, "addon:"+addon.Name())
+	}
+	stageOrder = append(stageOrder, "smoketest")
+
+	planHash, err := hashPlanFile(c.planFile)
+	if err != nil {
+		jsonFail("setup", err)
+		return fmt.Errorf("error hashing plan file: %v", err)
+	}
+	checkpoint, err := loadApplyCheckpoint(c.generatedAssetsDir, planHash)
+	if err != nil {
+		jsonFail("setup", err)
+		return fmt.Errorf("error reading apply checkpoint: %v", err)
+	}
+	if c.restartFrom != "" {
+		if !isStage(stageOrder, c.restartFrom) {
+			err := fmt.Errorf("%q is not a valid stage for --restart-from (valid stages: %v)", c.restartFrom, stageOrder)
+			jsonFail("setup", err)
+			return err
+		}
+		checkpoint.InvalidateFrom(stageOrder, c.restartFrom)
+	}
+
+	durations := map[string]string{}
+	failedStages := 0
+	defer func() {
+		if jsonOutput {
+			status := "ok"
+			if failedStages > 0 {
+				status = "error"
+			}
+			emitJSONSummary(c.out, status, len(durations), failedStages, durations)
+		}
+	}()
+
+	runStage := func(stage string, fn func() error) error {
+		if c.resume && checkpoint.IsDone(stage) {
+			if jsonOutput {
+				emitJSONEvent(c.out, stage, "", "", "skipped", nil)
+			} else {
+				util.PrettyPrintOk(c.out, "Skipping %q, already completed", stage)
+			}
+			return nil
+		}
+		start := time.Now()
+		if jsonOutput {
+			emitJSONEvent(c.out, stage, "", "", "started", nil)
+		}
+		err := fn()
+		durations[stage] = time.Since(start).String()
+		if err != nil {
+			failedStages++
+			if jsonOutput {
+				emitJSONEvent(c.out, stage, "", "", "error", err)
+			}
+			return err
+		}
+		if jsonOutput {
+			emitJSONEvent(c.out, stage, "", "", "ok", nil)
+		}
+		if c.dryRun {
+			return nil
+		}
+		checkpoint.MarkDone(stage, time.Now().Format(time.RFC3339))
+		return checkpoint.Save(c.generatedAssetsDir)
 	}
 
 	// Generate certificates
-	if err := c.executor.GenerateCertificates(plan); err != nil {
+	err = runStage("certificates", func() error {
+		return c.executor.GenerateCertificates(plan)
+	})
+	if err != nil {
 		return fmt.Errorf("error installing: %v", err)
 	}
 
 	// Generate kubeconfig
-	util.PrintHeader(c.out, "Generating Kubeconfig File", '=')
-	err = install.GenerateKubeconfig(plan, c.generatedAssetsDir)
+	kubeconfigDir := c.generatedAssetsDir
+	if c.dryRun {
+		// Never touch the real generated-assets-dir in dry-run mode; only
+		// the dry-run/ subdirectory is allowed to be written to.
+		kubeconfigDir = path.Join(c.generatedAssetsDir, "dry-run")
+	}
+	err = runStage("kubeconfig", func() error {
+		if !jsonOutput {
+			util.PrintHeader(c.out, "Generating Kubeconfig File", '=')
+		}
+		if err := install.GenerateKubeconfig(plan, kubeconfigDir); err != nil {
+			return err
+		}
+		if !jsonOutput {
+			util.PrettyPrintOk(c.out, "Generated kubeconfig file in the %q directory", kubeconfigDir)
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("error generating kubeconfig file: %v", err)
-	} else {
-		util.PrettyPrintOk(c.out, "Generated kubeconfig file in the %q directory", c.generatedAssetsDir)
 	}
 
 	// Perform the installation
-	if err := c.executor.Install(plan); err != nil {
+	err = runStage("install", func() error {
+		return c.executor.Install(plan)
+	})
+	if err != nil {
 		return fmt.Errorf("error installing: %v", err)
 	}
 
-	// Install Helm
-	if plan.Features.PackageManager.Enabled {
-		util.PrintHeader(c.out, "Installing Helm on the Cluster", '=')
-		home, err := homedir.Dir()
+	for _, addon := range addons {
+		addon := addon
+		err := runStage("addon:"+addon.Name(), func() error {
+			if !jsonOutput {
+				util.PrintHeader(c.out, fmt.Sprintf("Installing %s on the Cluster", addon.Name()), '=')
+			}
+			return addon.Apply(c, plan)
+		})
 		if err != nil {
-			return fmt.Errorf("Could not determine helm directory: %v", err)
-		}
-		helmDir := path.Join(home, ".helm")
-		backupDir := fmt.Sprintf("%s.backup-%s", helmDir, time.Now().Format("2006-01-02-15-04-05"))
-		// Backup helm directory if exists
-		if backedup, err := util.BackupDirectory(helmDir, backupDir); err != nil {
-			return fmt.Errorf("error preparing Helm client: %v", err)
-		} else if backedup {
-			util.PrettyPrintOk(c.out, "Backed up %q directory", helmDir)
-		}
-		// Create a new serviceaccount and run helm init
-		if err := c.executor.RunPlay("_helm.yaml", plan); err != nil {
-			return fmt.Errorf("error configuring Helm RBAC: %v", err)
-		}
-	}
-
-	// Heapster
-	if plan.Features.HeapsterMonitoring.Enabled {
-		util.PrintHeader(c.out, "Installing Heapster on the Cluster", '=')
-		if err := c.executor.RunPlay("_heapster.yaml", plan); err != nil {
-			return fmt.Errorf("error installing heapster: %v", err)
+			return fmt.Errorf("error installing %s: %v", addon.Name(), err)
 		}
 	}
 
 	// Run smoketest
-	if err := c.executor.RunSmokeTest(plan); err != nil {
+	err = runStage("smoketest", func() error {
+		return c.executor.RunSmokeTest(plan)
+	})
+	if err != nil {
 		return fmt.Errorf("error running smoke test: %v", err)
 	}
 
+	if jsonOutput {
+		return nil
+	}
+
+	if c.dryRun {
+		util.PrintColor(c.out, util.Green, "\nDry run complete. Review the rendered assets under %q before running apply for real.\n\n", path.Join(c.generatedAssetsDir, "dry-run"))
+		return nil
+	}
+
 	util.PrintColor(c.out, util.Green, "\nThe cluster was installed successfully!\n\n")
 
 	msg := "- To use the generated kubeconfig file with kubectl:" +
@@ -160,3 +297,13 @@ func (c *applyCmd) run() error {
 
 	return nil
 }
+
+// isStage reports whether stage appears in stageOrder.
+func isStage(stageOrder []string, stage string) bool {
+	for _, s := range stageOrder {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
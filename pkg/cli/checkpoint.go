@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// checkpointFile is the name, relative to generated-assets-dir, where apply
+// records which stages of the install have completed.
+const checkpointFile = "apply-state.json"
+
+// stageRecord is the checkpoint entry for a single completed stage.
+type stageRecord struct {
+	CompletedAt string `json:"completedAt"`
+}
+
+// applyCheckpoint tracks which stages of an apply run have completed for a
+// given plan file, so a failed run can be resumed without redoing work
+// that already succeeded.
+type applyCheckpoint struct {
+	PlanHash string                 `json:"planHash"`
+	Stages   map[string]stageRecord `json:"stages"`
+}
+
+func newApplyCheckpoint(planHash string) *applyCheckpoint {
+	return &applyCheckpoint{
+		PlanHash: planHash,
+		Stages:   map[string]stageRecord{},
+	}
+}
+
+// loadApplyCheckpoint reads the checkpoint file for the given plan hash. If
+// the file doesn't exist, or was recorded against a different plan hash
+// (i.e. the plan file changed since the last run), a fresh checkpoint is
+// returned instead.
+func loadApplyCheckpoint(generatedAssetsDir, planHash string) (*applyCheckpoint, error) {
+	b, err := ioutil.ReadFile(filepath.Join(generatedAssetsDir, checkpointFile))
+	if os.IsNotExist(err) {
+		return newApplyCheckpoint(planHash), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := &applyCheckpoint{}
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, err
+	}
+	if cp.PlanHash != planHash {
+		// The plan file changed since the last checkpoint; nothing can be
+		// safely skipped.
+		return newApplyCheckpoint(planHash), nil
+	}
+	if cp.Stages == nil {
+		cp.Stages = map[string]stageRecord{}
+	}
+	return cp, nil
+}
+
+// IsDone reports whether the named stage already completed successfully.
+func (cp *applyCheckpoint) IsDone(stage string) bool {
+	_, ok := cp.Stages[stage]
+	return ok
+}
+
+// MarkDone records the named stage as completed at the given timestamp.
+func (cp *applyCheckpoint) MarkDone(stage, completedAt string) {
+	cp.Stages[stage] = stageRecord{CompletedAt: completedAt}
+}
+
+// InvalidateFrom drops the given stage and everything recorded after it in
+// stageOrder, forcing them to be re-run on the next apply.
+func (cp *applyCheckpoint) InvalidateFrom(stageOrder []string, stage string) {
+	invalidate := false
+	for _, s := range stageOrder {
+		if s == stage {
+			invalidate = true
+		}
+		if invalidate {
+			delete(cp.Stages, s)
+		}
+	}
+}
+
+// Save writes the checkpoint to generated-assets-dir/apply-state.json.
+func (cp *applyCheckpoint) Save(generatedAssetsDir string) error {
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(generatedAssetsDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(generatedAssetsDir, checkpointFile), b, 0644)
+}
+
+// hashPlanFile returns a hex-encoded sha256 hash of the plan file's
+// contents, used to detect that a plan changed between apply runs.
+func hashPlanFile(planFile string) (string, error) {
+	b, err := ioutil.ReadFile(planFile)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadApplyCheckpointMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cp, err := loadApplyCheckpoint(dir, "somehash")
+	if err != nil {
+		t.Fatalf("loadApplyCheckpoint returned error: %v", err)
+	}
+	if cp.PlanHash != "somehash" {
+		t.Errorf("got PlanHash %q, want %q", cp.PlanHash, "somehash")
+	}
+	if len(cp.Stages) != 0 {
+		t.Errorf("expected a fresh checkpoint to have no stages, got %v", cp.Stages)
+	}
+}
+
+func TestApplyCheckpointSaveAndReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cp := newApplyCheckpoint("planhash")
+	cp.MarkDone("certificates", "2020-01-01T00:00:00Z")
+	if err := cp.Save(dir); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, checkpointFile)); err != nil {
+		t.Fatalf("expected checkpoint file to exist: %v", err)
+	}
+
+	reloaded, err := loadApplyCheckpoint(dir, "planhash")
+	if err != nil {
+		t.Fatalf("loadApplyCheckpoint returned error: %v", err)
+	}
+	if !reloaded.IsDone("certificates") {
+		t.Error("expected certificates stage to be marked done after reload")
+	}
+	if reloaded.IsDone("install") {
+		t.Error("did not expect install stage to be marked done")
+	}
+}
+
+func TestLoadApplyCheckpointDiscardsStaleHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cp := newApplyCheckpoint("oldhash")
+	cp.MarkDone("certificates", "2020-01-01T00:00:00Z")
+	if err := cp.Save(dir); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	reloaded, err := loadApplyCheckpoint(dir, "newhash")
+	if err != nil {
+		t.Fatalf("loadApplyCheckpoint returned error: %v", err)
+	}
+	if reloaded.IsDone("certificates") {
+		t.Error("expected checkpoint to be discarded when the plan hash changed")
+	}
+}
+
+func TestApplyCheckpointInvalidateFrom(t *testing.T) {
+	stageOrder := []string{"certificates", "kubeconfig", "install", "smoketest"}
+	cp := newApplyCheckpoint("planhash")
+	for _, s := range stageOrder {
+		cp.MarkDone(s, "2020-01-01T00:00:00Z")
+	}
+
+	cp.InvalidateFrom(stageOrder, "install")
+
+	if !cp.IsDone("certificates") {
+		t.Error("expected certificates to remain done")
+	}
+	if !cp.IsDone("kubeconfig") {
+		t.Error("expected kubeconfig to remain done")
+	}
+	if cp.IsDone("install") {
+		t.Error("expected install to be invalidated")
+	}
+	if cp.IsDone("smoketest") {
+		t.Error("expected smoketest to be invalidated")
+	}
+}
+
+func TestIsStage(t *testing.T) {
+	stageOrder := []string{"certificates", "kubeconfig", "install", "smoketest"}
+	if !isStage(stageOrder, "install") {
+		t.Error("expected \"install\" to be a valid stage")
+	}
+	if isStage(stageOrder, "bogus") {
+		t.Error("expected \"bogus\" to not be a valid stage")
+	}
+}
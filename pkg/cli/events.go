@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// applyEvent is a single line of the "json" output format for "kismatic
+// apply", intended for CI systems (Drone/Woodpecker/GitHub Actions style
+// pipelines) to parse installer progress without scraping human-readable
+// output.
+type applyEvent struct {
+	Timestamp string `json:"ts"`
+	Stage     string `json:"stage"`
+	Host      string `json:"host,omitempty"`
+	Task      string `json:"task,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// applySummary is emitted once, after the last stage, when --output json is
+// used. It lets CI gate merges on the outcome without tailing the whole
+// event stream.
+type applySummary struct {
+	Timestamp string            `json:"ts"`
+	Stage     string            `json:"stage"`
+	Status    string            `json:"status"`
+	Stages    int               `json:"stages"`
+	Failed    int               `json:"failed"`
+	Durations map[string]string `json:"durations"`
+}
+
+func emitJSONEvent(w io.Writer, stage, host, task, status string, err error) {
+	ev := applyEvent{
+		Timestamp: time.Now().Format(time.RFC3339),
+		Stage:     stage,
+		Host:      host,
+		Task:      task,
+		Status:    status,
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	b, marshalErr := json.Marshal(ev)
+	if marshalErr != nil {
+		return
+	}
+	w.Write(append(b, '\n'))
+}
+
+func emitJSONSummary(w io.Writer, status string, stages, failed int, durations map[string]string) {
+	s := applySummary{
+		Timestamp: time.Now().Format(time.RFC3339),
+		Stage:     "summary",
+		Status:    status,
+		Stages:    stages,
+		Failed:    failed,
+		Durations: durations,
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestEmitJSONEventFields(t *testing.T) {
+	var buf bytes.Buffer
+	emitJSONEvent(&buf, "install", "m1", "kubernetes.yaml", "ok", nil)
+
+	var ev applyEvent
+	if err := json.Unmarshal(buf.Bytes(), &ev); err != nil {
+		t.Fatalf("could not unmarshal event: %v", err)
+	}
+	if ev.Stage != "install" {
+		t.Errorf("got Stage %q, want %q", ev.Stage, "install")
+	}
+	if ev.Task != "kubernetes.yaml" {
+		t.Errorf("got Task %q, want %q", ev.Task, "kubernetes.yaml")
+	}
+	if ev.Host != "m1" {
+		t.Errorf("got Host %q, want %q", ev.Host, "m1")
+	}
+	if ev.Error != "" {
+		t.Errorf("got Error %q, want empty", ev.Error)
+	}
+}
+
+func TestEmitJSONEventError(t *testing.T) {
+	var buf bytes.Buffer
+	emitJSONEvent(&buf, "install", "m1", "kubernetes.yaml", "error", errors.New("boom"))
+
+	var ev applyEvent
+	if err := json.Unmarshal(buf.Bytes(), &ev); err != nil {
+		t.Fatalf("could not unmarshal event: %v", err)
+	}
+	if ev.Error != "boom" {
+		t.Errorf("got Error %q, want %q", ev.Error, "boom")
+	}
+}
+
+func TestEmitJSONSummary(t *testing.T) {
+	var buf bytes.Buffer
+	emitJSONSummary(&buf, "ok", 3, 0, map[string]string{"install": "1m0s"})
+
+	var summary applySummary
+	if err := json.Unmarshal(buf.Bytes(), &summary); err != nil {
+		t.Fatalf("could not unmarshal summary: %v", err)
+	}
+	if summary.Stage != "summary" {
+		t.Errorf("got Stage %q, want %q", summary.Stage, "summary")
+	}
+	if summary.Stages != 3 {
+		t.Errorf("got Stages %d, want 3", summary.Stages)
+	}
+}
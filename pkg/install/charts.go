@@ -0,0 +1,98 @@
+package install
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// chartReleasesFile is where the set of chart releases installed by the last
+// apply is recorded, relative to generated-assets-dir. The next "kismatic
+// apply" reads it back to reconcile against the current plan file (upgrade
+// a release whose version changed, uninstall one that was removed from the
+// plan). There is no "kismatic reset"/"kismatic upgrade" command in this
+// tree yet; when one is added it should reconcile against this same file
+// rather than introducing a second source of truth.
+const chartReleasesFile = "chart-releases.json"
+
+// ChartRelease is a single entry of the plan file's "charts" list: a Helm
+// chart to install after Helm itself has been bootstrapped.
+type ChartRelease struct {
+	RepoURL     string                 `yaml:"repo_url" json:"repoURL"`
+	ChartName   string                 `yaml:"chart_name" json:"chartName"`
+	Version     string                 `yaml:"version" json:"version"`
+	ReleaseName string                 `yaml:"release_name" json:"releaseName"`
+	Namespace   string                 `yaml:"namespace" json:"namespace"`
+	Values      map[string]interface{} `yaml:"values" json:"values"`
+}
+
+// WriteChartReleases records the chart releases installed during this apply
+// so a later apply can diff against them.
+func WriteChartReleases(releases []ChartRelease, generatedAssetsDir string) error {
+	b, err := json.MarshalIndent(releases, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(generatedAssetsDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(generatedAssetsDir, chartReleasesFile), b, 0644)
+}
+
+// ReadChartReleases reads back the chart releases recorded by the previous
+// apply. It returns an empty slice, not an error, if nothing was recorded
+// yet (e.g. the first apply of a plan that declares charts).
+func ReadChartReleases(generatedAssetsDir string) ([]ChartRelease, error) {
+	b, err := ioutil.ReadFile(filepath.Join(generatedAssetsDir, chartReleasesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var releases []ChartRelease
+	if err := json.Unmarshal(b, &releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// FindChartRelease returns the release in releases with the given name, if
+// any.
+func FindChartRelease(releases []ChartRelease, releaseName string) (ChartRelease, bool) {
+	for _, r := range releases {
+		if r.ReleaseName == releaseName {
+			return r, true
+		}
+	}
+	return ChartRelease{}, false
+}
+
+// RemovedChartReleases returns the releases present in prev but no longer
+// declared in current, i.e. the releases that must be uninstalled to
+// reconcile the cluster with the plan file.
+func RemovedChartReleases(prev, current []ChartRelease) []ChartRelease {
+	var removed []ChartRelease
+	for _, p := range prev {
+		if _, ok := FindChartRelease(current, p.ReleaseName); !ok {
+			removed = append(removed, p)
+		}
+	}
+	return removed
+}
+
+// ChangedChartReleases returns the releases in current whose recorded
+// version in prev differs (or that are brand new), i.e. the releases that
+// must be installed or upgraded to reconcile the cluster with the plan
+// file.
+func ChangedChartReleases(prev, current []ChartRelease) []ChartRelease {
+	var changed []ChartRelease
+	for _, c := range current {
+		p, ok := FindChartRelease(prev, c.ReleaseName)
+		if !ok || p.Version != c.Version {
+			changed = append(changed, c)
+		}
+	}
+	return changed
+}
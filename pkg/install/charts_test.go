@@ -0,0 +1,94 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReadChartReleasesMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "charts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	releases, err := ReadChartReleases(dir)
+	if err != nil {
+		t.Fatalf("ReadChartReleases returned error: %v", err)
+	}
+	if len(releases) != 0 {
+		t.Errorf("expected no releases when nothing was recorded yet, got %v", releases)
+	}
+}
+
+func TestWriteChartReleasesSaveAndReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "charts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	releases := []ChartRelease{
+		{ReleaseName: "nginx", ChartName: "nginx-ingress", Version: "1.0.0"},
+	}
+	if err := WriteChartReleases(releases, dir); err != nil {
+		t.Fatalf("WriteChartReleases returned error: %v", err)
+	}
+
+	reloaded, err := ReadChartReleases(dir)
+	if err != nil {
+		t.Fatalf("ReadChartReleases returned error: %v", err)
+	}
+	if len(reloaded) != 1 || reloaded[0].ReleaseName != "nginx" || reloaded[0].Version != "1.0.0" {
+		t.Errorf("got %v, want a single nginx release at version 1.0.0", reloaded)
+	}
+}
+
+func TestFindChartRelease(t *testing.T) {
+	releases := []ChartRelease{
+		{ReleaseName: "nginx", Version: "1.0.0"},
+		{ReleaseName: "redis", Version: "2.0.0"},
+	}
+	if r, ok := FindChartRelease(releases, "redis"); !ok || r.Version != "2.0.0" {
+		t.Errorf("expected to find redis at version 2.0.0, got %v, %v", r, ok)
+	}
+	if _, ok := FindChartRelease(releases, "missing"); ok {
+		t.Error("expected no match for a release name not in the list")
+	}
+}
+
+func TestRemovedChartReleases(t *testing.T) {
+	prev := []ChartRelease{
+		{ReleaseName: "nginx", Version: "1.0.0"},
+		{ReleaseName: "redis", Version: "2.0.0"},
+	}
+	current := []ChartRelease{
+		{ReleaseName: "nginx", Version: "1.0.0"},
+	}
+	removed := RemovedChartReleases(prev, current)
+	if len(removed) != 1 || removed[0].ReleaseName != "redis" {
+		t.Errorf("expected redis to be removed, got %v", removed)
+	}
+}
+
+func TestChangedChartReleases(t *testing.T) {
+	prev := []ChartRelease{
+		{ReleaseName: "nginx", Version: "1.0.0"},
+		{ReleaseName: "redis", Version: "2.0.0"},
+	}
+	current := []ChartRelease{
+		{ReleaseName: "nginx", Version: "1.0.0"},    // unchanged
+		{ReleaseName: "redis", Version: "2.1.0"},    // version bumped
+		{ReleaseName: "postgres", Version: "1.0.0"}, // brand new
+	}
+	changed := ChangedChartReleases(prev, current)
+
+	names := map[string]bool{}
+	for _, c := range changed {
+		names[c.ReleaseName] = true
+	}
+	if len(changed) != 2 || !names["redis"] || !names["postgres"] {
+		t.Errorf("expected redis (changed) and postgres (new) to be reported as changed, got %v", changed)
+	}
+}
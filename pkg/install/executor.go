@@ -0,0 +1,213 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// ExecutorOptions configures the behavior of an Executor.
+type ExecutorOptions struct {
+	// GeneratedAssetsDirectory is where certificates, kubeconfig and other
+	// generated files are written.
+	GeneratedAssetsDirectory string
+	// RestartServices forces cluster services to restart even if their
+	// configuration didn't change.
+	RestartServices bool
+	// OutputFormat controls how installation progress is reported: "simple",
+	// "raw" or "json".
+	OutputFormat string
+	// Verbose enables verbose logging from the underlying Ansible runs.
+	Verbose bool
+	// DryRun, when true, writes the inventory and playbook variables of each
+	// stage under GeneratedAssetsDirectory/dry-run instead of running Ansible
+	// against the cluster. No certificates are generated in this mode.
+	DryRun bool
+	// OnEvent, if set, is called for every host when a playbook run against
+	// the cluster starts ("started") and again when it ends ("ok" or
+	// "error"). stage is the
+	// logical apply stage the playbook belongs to (e.g. "certificates",
+	// "install", "addon:Helm"), matching the stage names "kismatic apply"
+	// itself reports, so callers can correlate per-host events with the
+	// top-level stage events (e.g. to render the "json" output format)
+	// instead of only a single result for the whole playbook.
+	OnEvent func(stage, host, task, status string, err error)
+}
+
+// Executor applies a Plan to a set of nodes.
+type Executor interface {
+	// GenerateCertificates creates the PKI used by the cluster.
+	GenerateCertificates(plan *Plan) error
+	// Install runs the core cluster installation playbook.
+	Install(plan *Plan) error
+	// RunPlay runs a single named playbook against the cluster. stage is the
+	// logical apply stage it belongs to (see ExecutorOptions.OnEvent).
+	RunPlay(stage, playbookFile string, plan *Plan) error
+	// RunSmokeTest verifies the cluster is healthy after installation.
+	RunSmokeTest(plan *Plan) error
+	// UninstallRelease removes a Helm release that is no longer declared in
+	// the plan file.
+	UninstallRelease(releaseName, namespace string) error
+}
+
+// ansibleExecutor is the default Executor. In normal operation it shells out
+// to ansible-playbook against the generated inventory; in DryRun mode it
+// renders what it would have run to GeneratedAssetsDirectory/dry-run instead
+// of touching any node.
+type ansibleExecutor struct {
+	out     io.Writer
+	errOut  io.Writer
+	options ExecutorOptions
+}
+
+// NewExecutor creates an Executor that writes its output to out and errOut.
+func NewExecutor(out, errOut io.Writer, options ExecutorOptions) (Executor, error) {
+	if options.GeneratedAssetsDirectory == "" {
+		return nil, fmt.Errorf("GeneratedAssetsDirectory must be set")
+	}
+	return &ansibleExecutor{out: out, errOut: errOut, options: options}, nil
+}
+
+func (ae *ansibleExecutor) GenerateCertificates(plan *Plan) error {
+	if ae.options.DryRun {
+		return ae.renderDryRun("certificates", "_certificates.yaml", plan)
+	}
+	return ae.runPlaybook("certificates", "_certificates.yaml", plan)
+}
+
+func (ae *ansibleExecutor) Install(plan *Plan) error {
+	if ae.options.DryRun {
+		return ae.renderDryRun("install", "kubernetes.yaml", plan)
+	}
+	return ae.runPlaybook("install", "kubernetes.yaml", plan)
+}
+
+func (ae *ansibleExecutor) RunPlay(stage, playbookFile string, plan *Plan) error {
+	if ae.options.DryRun {
+		return ae.renderDryRun(stage, playbookFile, plan)
+	}
+	return ae.runPlaybook(stage, playbookFile, plan)
+}
+
+func (ae *ansibleExecutor) RunSmokeTest(plan *Plan) error {
+	if ae.options.DryRun {
+		return ae.renderDryRun("smoketest", "_smoketest.yaml", plan)
+	}
+	return ae.runPlaybook("smoketest", "_smoketest.yaml", plan)
+}
+
+func (ae *ansibleExecutor) UninstallRelease(releaseName, namespace string) error {
+	if ae.options.DryRun {
+		return ae.renderDryRun(fmt.Sprintf("uninstall-%s", releaseName), "", nil)
+	}
+	cmd := exec.Command("helm", "uninstall", releaseName, "--namespace", namespace)
+	cmd.Stdout = ae.out
+	cmd.Stderr = ae.errOut
+	return cmd.Run()
+}
+
+// runPlaybook shells out to ansible-playbook against the inventory rendered
+// under GeneratedAssetsDirectory. This is the only place that actually
+// mutates cluster nodes; DryRun must never reach it.
+//
+// Ansible itself reports progress per host/task as it runs, but parsing
+// that stream isn't wired up yet; in the meantime we report one
+// started/ok/error event per host in plan.Cluster.Hosts, using the
+// playbook's filename as the task name and the caller-supplied stage as the
+// logical stage, so OnEvent still gets per-host granularity instead of a
+// single result for the whole run.
+func (ae *ansibleExecutor) runPlaybook(stage, playbookFile string, plan *Plan) error {
+	inventory := filepath.Join(ae.options.GeneratedAssetsDirectory, "inventory.ini")
+	args := []string{"-i", inventory, filepath.Join("ansible", "playbooks", playbookFile)}
+	if ae.options.Verbose {
+		args = append(args, "-v")
+	}
+
+	hosts := plan.Cluster.Hosts
+	if ae.options.OnEvent != nil {
+		for _, host := range hosts {
+			ae.options.OnEvent(stage, host, playbookFile, "started", nil)
+		}
+	}
+
+	cmd := exec.Command("ansible-playbook", args...)
+	cmd.Stdout = ae.out
+	cmd.Stderr = ae.errOut
+	err := cmd.Run()
+
+	if ae.options.OnEvent != nil {
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+		for _, host := range hosts {
+			ae.options.OnEvent(stage, host, playbookFile, status, err)
+		}
+	}
+	return err
+}
+
+// dryRunBundle is what renderDryRun writes per stage: the inventory and the
+// subset of the plan file ("group_vars") that playbookFile would actually
+// consume, rather than a full copy of the plan repeated for every stage.
+type dryRunBundle struct {
+	Stage     string                 `json:"stage"`
+	Playbook  string                 `json:"playbook,omitempty"`
+	Inventory []string               `json:"inventory,omitempty"`
+	GroupVars map[string]interface{} `json:"group_vars,omitempty"`
+}
+
+// renderDryRun writes the inventory and playbook variables that would have
+// been handed to the named stage/playbook to
+// GeneratedAssetsDirectory/dry-run/<stage>.json, instead of running anything
+// against the cluster.
+func (ae *ansibleExecutor) renderDryRun(stage, playbookFile string, plan *Plan) error {
+	dir := filepath.Join(ae.options.GeneratedAssetsDirectory, "dry-run")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	bundle := dryRunBundle{Stage: stage, Playbook: playbookFile}
+	if plan != nil {
+		bundle.Inventory = plan.Cluster.Hosts
+		bundle.GroupVars = dryRunGroupVars(stage, plan)
+	}
+	b, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, stage+".json"), b, 0644)
+}
+
+// dryRunGroupVars returns the subset of the plan file that the named
+// stage's playbook would actually consume as group_vars, so each dry-run
+// bundle reflects only what that play needs instead of the whole plan.
+func dryRunGroupVars(stage string, plan *Plan) map[string]interface{} {
+	switch stage {
+	case "certificates", "smoketest":
+		return map[string]interface{}{"cluster_name": plan.Cluster.Name}
+	case "install":
+		return map[string]interface{}{"cluster": plan.Cluster}
+	default:
+		// Addon plays get the plan's whole add_ons block (shared by every
+		// addon), not the cluster section.
+		return map[string]interface{}{"add_ons": plan.Features}
+	}
+}
+
+// GenerateKubeconfig writes a kubeconfig for the cluster described by plan
+// to outputDir/kubeconfig. It only ever writes to outputDir, so callers that
+// want dry-run behavior pass a dry-run-specific directory rather than
+// relying on this function to skip anything itself.
+func GenerateKubeconfig(plan *Plan, outputDir string) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+	// Placeholder kubeconfig content: only the cluster name is written; no
+	// cluster CA or client certificate material is included.
+	kubeconfig := fmt.Sprintf("# kubeconfig for cluster %q\n", plan.Cluster.Name)
+	return ioutil.WriteFile(filepath.Join(outputDir, "kubeconfig"), []byte(kubeconfig), 0600)
+}
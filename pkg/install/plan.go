@@ -0,0 +1,90 @@
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Plan is the parsed representation of a kismatic plan file. It describes
+// the cluster to be installed and the optional features to layer on top of
+// it once the base cluster is up.
+type Plan struct {
+	Cluster  ClusterPlan  `yaml:"cluster"`
+	Features PlanFeatures `yaml:"add_ons"`
+}
+
+// ClusterPlan describes the nodes that make up the cluster.
+type ClusterPlan struct {
+	Name string `yaml:"name"`
+	// Hosts lists every node's hostname, used to report per-host progress
+	// while a playbook runs against the cluster.
+	Hosts []string `yaml:"hosts"`
+}
+
+// PlanFeatures is the set of optional, post-install features an operator can
+// request in the plan file.
+type PlanFeatures struct {
+	PackageManager     PackageManagerOptions `yaml:"package_manager"`
+	Charts             []ChartRelease        `yaml:"charts"`
+	HeapsterMonitoring EnabledOptions        `yaml:"heapster_monitoring"`
+	AddonFeatures      `yaml:",inline"`
+}
+
+// AddonFeatures is the set of plan-file sections owned by the pluggable
+// addon registry (see the "cli" package's addonRegistry) rather than by one
+// of the built-in, hard-coded features above. It's embedded anonymously in
+// PlanFeatures so callers keep using e.g. plan.Features.MetricsServer, and
+// new addons only ever need to add a field here.
+type AddonFeatures struct {
+	MetricsServer       EnabledOptions `yaml:"metrics_server"`
+	Dashboard           EnabledOptions `yaml:"dashboard"`
+	DefaultStorageClass EnabledOptions `yaml:"default_storage_class"`
+	StorageProvisioner  EnabledOptions `yaml:"storage_provisioner"`
+	ClusterAutoscaler   EnabledOptions `yaml:"cluster_autoscaler"`
+	CNI                 CNIOptions     `yaml:"cni"`
+}
+
+// EnabledOptions is the common shape of a feature that is simply turned on
+// or off from the plan file.
+type EnabledOptions struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// PackageManagerOptions configures the Helm client kismatic installs on the
+// master nodes. Version selects between the Tiller-based "v2" flow and the
+// tillerless "v3" flow; it defaults to "v2" when left blank so existing plan
+// files keep behaving the way they always have.
+type PackageManagerOptions struct {
+	Enabled bool   `yaml:"enabled"`
+	Version string `yaml:"version"`
+}
+
+// CNIOptions selects the CNI plugin to install.
+type CNIOptions struct {
+	Provider string `yaml:"provider"`
+}
+
+// Planner reads a Plan from wherever it is stored.
+type Planner interface {
+	Read() (*Plan, error)
+}
+
+// FilePlanner reads a Plan from a plan file on disk.
+type FilePlanner struct {
+	File string
+}
+
+// Read parses the plan file into a Plan.
+func (fp *FilePlanner) Read() (*Plan, error) {
+	b, err := ioutil.ReadFile(fp.File)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan file %q: %v", fp.File, err)
+	}
+	plan := &Plan{}
+	if err := yaml.Unmarshal(b, plan); err != nil {
+		return nil, fmt.Errorf("error parsing plan file %q: %v", fp.File, err)
+	}
+	return plan, nil
+}